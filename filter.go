@@ -0,0 +1,435 @@
+package main
+
+import "fmt"
+import "regexp"
+import "strconv"
+import "strings"
+
+// Filter is a parsed -filter expression. Eval reports whether proc
+// satisfies it.
+type Filter interface {
+	Eval(proc *Process) bool
+}
+
+// ParseFilter parses a -filter expression like
+// `rss>100M && name~"^java"` or `user==root || cpu>0.05` into a Filter.
+//
+// Grammar:
+//
+//	expr       := orExpr
+//	orExpr     := andExpr ( "||" andExpr )*
+//	andExpr    := unaryExpr ( "&&" unaryExpr )*
+//	unaryExpr  := "!" unaryExpr | primary
+//	primary    := "(" expr ")" | comparison
+//	comparison := IDENT op value
+//	value      := NUMBER | STRING | IDENT
+//
+// op is one of == != < <= > >= ~, and IDENT/NUMBER/STRING are the obvious
+// lexical tokens, with NUMBER accepting a trailing K/M/G size suffix.
+func ParseFilter(src string) (Filter, error) {
+	toks, err := lexFilter(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{toks: toks}
+	filter, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q in filter expression", p.peek().text)
+	}
+
+	return filter, nil
+}
+
+// filterField* enumerate the identifiers a comparison may name, and
+// whether they compare numerically or as strings.
+var filterNumericFields = map[string]func(proc *Process) float64{
+	"pid":       func(proc *Process) float64 { return float64(proc.Pid) },
+	"ppid":      func(proc *Process) float64 { return float64(proc.PPid) },
+	"cpu":       func(proc *Process) float64 { return float64(proc.CPU) },
+	"rss":       func(proc *Process) float64 { return float64(proc.RSS) },
+	"pss":       func(proc *Process) float64 { return float64(proc.PSS) },
+	"accum_rss": func(proc *Process) float64 { return float64(proc.CalcAccumRSS()) },
+	"accum_cpu": func(proc *Process) float64 { return float64(proc.CalcAccumCPU()) },
+	"threads":   func(proc *Process) float64 { return float64(proc.Threads) },
+}
+
+var filterStringFields = map[string]func(proc *Process) string{
+	"name": func(proc *Process) string { return proc.PrettyName },
+	"exe":  func(proc *Process) string { return proc.Exe },
+	"user": func(proc *Process) string { return proc.Username },
+}
+
+// numericCompareFilter is a comparison like `rss>100M` or `cpu<=0.5`.
+type numericCompareFilter struct {
+	get func(proc *Process) float64
+	op  string
+	val float64
+}
+
+func (f *numericCompareFilter) Eval(proc *Process) bool {
+	v := f.get(proc)
+	switch f.op {
+	case "==":
+		return v == f.val
+	case "!=":
+		return v != f.val
+	case "<":
+		return v < f.val
+	case "<=":
+		return v <= f.val
+	case ">":
+		return v > f.val
+	case ">=":
+		return v >= f.val
+	default:
+		return false
+	}
+}
+
+// stringCompareFilter is a comparison like `user==root`, `name!=bash` or
+// `name~"^java"`.
+type stringCompareFilter struct {
+	get   func(proc *Process) string
+	op    string
+	val   string
+	regex *regexp.Regexp
+}
+
+func (f *stringCompareFilter) Eval(proc *Process) bool {
+	v := f.get(proc)
+	switch f.op {
+	case "==":
+		return v == f.val
+	case "!=":
+		return v != f.val
+	case "~":
+		return f.regex.MatchString(v)
+	default:
+		return false
+	}
+}
+
+type andFilter struct{ left, right Filter }
+
+func (f *andFilter) Eval(proc *Process) bool { return f.left.Eval(proc) && f.right.Eval(proc) }
+
+type orFilter struct{ left, right Filter }
+
+func (f *orFilter) Eval(proc *Process) bool { return f.left.Eval(proc) || f.right.Eval(proc) }
+
+type notFilter struct{ inner Filter }
+
+func (f *notFilter) Eval(proc *Process) bool { return !f.inner.Eval(proc) }
+
+// filterParser is a recursive-descent parser over the token stream from
+// lexFilter.
+type filterParser struct {
+	toks []token
+	pos  int
+}
+
+func (p *filterParser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *filterParser) next() token {
+	tok := p.toks[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *filterParser) parseExpr() (Filter, error) {
+	return p.parseOr()
+}
+
+func (p *filterParser) parseOr() (Filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orFilter{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (Filter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokAnd {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andFilter{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (Filter, error) {
+	if p.peek().kind == tokNot {
+		p.next()
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notFilter{inner}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *filterParser) parsePrimary() (Filter, error) {
+	if p.peek().kind == tokLParen {
+		p.next()
+		inner, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokRParen {
+			return nil, fmt.Errorf("expected ) in filter expression, got %q", p.peek().text)
+		}
+		p.next()
+		return inner, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (Filter, error) {
+	field := p.next()
+	if field.kind != tokIdent {
+		return nil, fmt.Errorf("expected a field name in filter expression, got %q", field.text)
+	}
+
+	op := p.next()
+	switch op.kind {
+	case tokEq, tokNe, tokLt, tokLe, tokGt, tokGe, tokMatch:
+	default:
+		return nil, fmt.Errorf("expected a comparison operator after %q, got %q", field.text, op.text)
+	}
+
+	value := p.next()
+	switch value.kind {
+	case tokNumber, tokString, tokIdent:
+	default:
+		return nil, fmt.Errorf("expected a value after %q %s, got %q", field.text, op.text, value.text)
+	}
+
+	if get, ok := filterNumericFields[field.text]; ok {
+		if op.kind == tokMatch {
+			return nil, fmt.Errorf("~ can't be used with numeric field %q", field.text)
+		}
+		num, err := parseFilterNumber(value.text)
+		if err != nil {
+			return nil, err
+		}
+		return &numericCompareFilter{get, op.text, num}, nil
+	}
+
+	if get, ok := filterStringFields[field.text]; ok {
+		if op.kind == tokMatch {
+			regex, err := regexp.Compile(value.text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex %q: %w", value.text, err)
+			}
+			return &stringCompareFilter{get, op.text, value.text, regex}, nil
+		}
+		if op.kind != tokEq && op.kind != tokNe {
+			return nil, fmt.Errorf("%q only supports ==, != and ~, not %s", field.text, op.text)
+		}
+		return &stringCompareFilter{get, op.text, value.text, nil}, nil
+	}
+
+	return nil, fmt.Errorf("unknown filter field %q", field.text)
+}
+
+// parseFilterNumber parses a NUMBER token, which is a plain decimal number
+// optionally followed by a K/M/G size suffix. Fields like rss/pss/accum_rss
+// are measured in KiB, so the suffix scales the literal into that unit
+// (e.g. "100M" is 100 MiB, i.e. 102400 in rss's native KiB).
+func parseFilterNumber(s string) (float64, error) {
+	mult := 1.0
+	if len(s) > 0 {
+		switch s[len(s)-1] {
+		case 'k', 'K':
+			mult = 1
+			s = s[:len(s)-1]
+		case 'm', 'M':
+			mult = 1024
+			s = s[:len(s)-1]
+		case 'g', 'G':
+			mult = 1024 * 1024
+			s = s[:len(s)-1]
+		}
+	}
+
+	num, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q in filter expression", s)
+	}
+
+	return num * mult, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokAnd
+	tokOr
+	tokNot
+	tokEq
+	tokNe
+	tokLt
+	tokLe
+	tokGt
+	tokGe
+	tokMatch
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// lexFilter tokenizes a -filter expression.
+func lexFilter(src string) ([]token, error) {
+	var toks []token
+	i := 0
+
+	for i < len(src) {
+		c := src[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+
+		case c == '(':
+			toks = append(toks, token{tokLParen, "("})
+			i++
+		case c == ')':
+			toks = append(toks, token{tokRParen, ")"})
+			i++
+
+		case strings.HasPrefix(src[i:], "&&"):
+			toks = append(toks, token{tokAnd, "&&"})
+			i += 2
+		case strings.HasPrefix(src[i:], "||"):
+			toks = append(toks, token{tokOr, "||"})
+			i += 2
+
+		case strings.HasPrefix(src[i:], "=="):
+			toks = append(toks, token{tokEq, "=="})
+			i += 2
+		case strings.HasPrefix(src[i:], "!="):
+			toks = append(toks, token{tokNe, "!="})
+			i += 2
+		case strings.HasPrefix(src[i:], "<="):
+			toks = append(toks, token{tokLe, "<="})
+			i += 2
+		case strings.HasPrefix(src[i:], ">="):
+			toks = append(toks, token{tokGe, ">="})
+			i += 2
+		case c == '<':
+			toks = append(toks, token{tokLt, "<"})
+			i++
+		case c == '>':
+			toks = append(toks, token{tokGt, ">"})
+			i++
+		case c == '~':
+			toks = append(toks, token{tokMatch, "~"})
+			i++
+		case c == '!':
+			toks = append(toks, token{tokNot, "!"})
+			i++
+
+		case c == '"':
+			str, n, err := lexFilterString(src[i:])
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, token{tokString, str})
+			i += n
+
+		case isFilterIdentStart(c):
+			j := i + 1
+			for j < len(src) && isFilterIdentPart(src[j]) {
+				j++
+			}
+			toks = append(toks, token{tokIdent, src[i:j]})
+			i = j
+
+		case c >= '0' && c <= '9' || c == '.':
+			j := i + 1
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			if j < len(src) && strings.ContainsRune("kKmMgG", rune(src[j])) {
+				j++
+			}
+			toks = append(toks, token{tokNumber, src[i:j]})
+			i = j
+
+		default:
+			return nil, fmt.Errorf("unexpected character %q in filter expression", string(c))
+		}
+	}
+
+	toks = append(toks, token{tokEOF, ""})
+	return toks, nil
+}
+
+// lexFilterString reads a double-quoted string starting at s[0], returning
+// its unescaped contents and the number of bytes consumed from s,
+// including both quotes.
+func lexFilterString(s string) (string, int, error) {
+	var sb strings.Builder
+	i := 1
+	for i < len(s) {
+		c := s[i]
+		if c == '"' {
+			return sb.String(), i + 1, nil
+		}
+		if c == '\\' && i+1 < len(s) {
+			sb.WriteByte(s[i+1])
+			i += 2
+			continue
+		}
+		sb.WriteByte(c)
+		i++
+	}
+
+	return "", 0, fmt.Errorf("unterminated string in filter expression")
+}
+
+func isFilterIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isFilterIdentPart(c byte) bool {
+	return isFilterIdentStart(c) || (c >= '0' && c <= '9') || c == '_' || c == '.'
+}
@@ -0,0 +1,133 @@
+package main
+
+import "testing"
+
+func mkProc(pid int, name string, rss int, cpu float32) *Process {
+	return &Process{Pid: pid, PrettyName: name, RSS: rss, PSS: rss, CPU: cpu}
+}
+
+func TestParseFilterEval(t *testing.T) {
+	cases := []struct {
+		name string
+		expr string
+		proc *Process
+		want bool
+	}{
+		{"numeric gt", "rss>100", mkProc(1, "a", 200, 0), true},
+		{"numeric gt false", "rss>100", mkProc(1, "a", 50, 0), false},
+		{"numeric size suffix K", "rss>1K", mkProc(1, "a", 2, 0), true},
+		{"numeric size suffix M", "rss>1M", mkProc(1, "a", 2000, 0), true},
+		{"numeric size suffix G", "rss>1G", mkProc(1, "a", 2*1024*1024, 0), true},
+		{"numeric lte", "cpu<=0.5", mkProc(1, "a", 0, 0.5), true},
+		{"numeric eq", "pid==42", &Process{Pid: 42}, true},
+		{"numeric ne", "pid!=42", &Process{Pid: 42}, false},
+		{"string eq", "name==bash", mkProc(1, "bash", 0, 0), true},
+		{"string ne", "name!=bash", mkProc(1, "sh", 0, 0), true},
+		{"string regex match", `name~"^ba"`, mkProc(1, "bash", 0, 0), true},
+		{"string regex no match", `name~"^ba"`, mkProc(1, "sh", 0, 0), false},
+		{"and", "rss>1 && cpu>0.1", mkProc(1, "a", 10, 0.5), true},
+		{"and short-circuit false", "rss>100 && cpu>0.1", mkProc(1, "a", 10, 0.5), false},
+		{"or", "rss>100 || cpu>0.1", mkProc(1, "a", 10, 0.5), true},
+		{"not", "!(rss>100)", mkProc(1, "a", 10, 0), true},
+		{"parens", "(rss>1 && cpu>1) || name==a", mkProc(1, "a", 10, 0), true},
+		{"bareword string value", "user==root", &Process{Username: "root"}, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			filter, err := ParseFilter(c.expr)
+			if err != nil {
+				t.Fatalf("ParseFilter(%q) returned error: %s", c.expr, err)
+			}
+			if got := filter.Eval(c.proc); got != c.want {
+				t.Errorf("ParseFilter(%q).Eval(...) = %v, want %v", c.expr, got, c.want)
+			}
+		})
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	cases := []string{
+		"bogus==1",
+		"rss~1",
+		"name<1",
+		"rss>",
+		"rss>1 &&",
+		"(rss>1",
+		`name~"(unterminated`,
+	}
+
+	for _, expr := range cases {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := ParseFilter(expr); err == nil {
+				t.Errorf("ParseFilter(%q) expected an error, got nil", expr)
+			}
+		})
+	}
+}
+
+// TestFilterTreePromotion checks that a process failing the filter is
+// dropped while its matching descendants are promoted to the nearest
+// matching ancestor.
+func TestFilterTreePromotion(t *testing.T) {
+	root := mkProc(1, "init", 0, 0)
+	middle := mkProc(2, "dash", 0, 0)
+	nginxMaster := mkProc(3, "nginx-master", 0, 0)
+	nginxWorker := mkProc(4, "nginx-worker", 0, 0)
+
+	root.Children = []*Process{middle}
+	middle.Children = []*Process{nginxMaster}
+	nginxMaster.Children = []*Process{nginxWorker}
+
+	filter, err := ParseFilter(`name~"^nginx"`)
+	if err != nil {
+		t.Fatalf("ParseFilter returned error: %s", err)
+	}
+
+	pruned := FilterTree(root, filter)
+	if pruned.Pid != root.Pid {
+		t.Fatalf("root should always be kept, got pid %d", pruned.Pid)
+	}
+	if len(pruned.Children) != 1 || pruned.Children[0].Pid != nginxMaster.Pid {
+		t.Fatalf("expected non-matching %q to be pruned and %q promoted to root, got children %v",
+			middle.PrettyName, nginxMaster.PrettyName, pruned.Children)
+	}
+	if len(pruned.Children[0].Children) != 1 || pruned.Children[0].Children[0].Pid != nginxWorker.Pid {
+		t.Fatalf("expected %q to remain under %q", nginxWorker.PrettyName, nginxMaster.PrettyName)
+	}
+}
+
+// TestFilterTreeAccumResetsAfterPrune guards against a clone carrying over
+// CalcAccumRSS/CalcAccumCPU totals memoized on the original Process by a
+// filter expression that evaluates accum_rss/accum_cpu on every node
+// before pruning happens: the pruned copy must recompute over its own
+// (possibly smaller) set of children rather than reporting a stale,
+// unpruned total.
+func TestFilterTreeAccumResetsAfterPrune(t *testing.T) {
+	root := mkProc(1, "root", 10, 0)
+	big := mkProc(2, "big", 100, 0)
+	small := mkProc(3, "small", 1, 0)
+
+	root.Children = []*Process{big}
+	big.Children = []*Process{small}
+
+	filter, err := ParseFilter("accum_rss>1")
+	if err != nil {
+		t.Fatalf("ParseFilter returned error: %s", err)
+	}
+
+	// Evaluating the filter memoizes AccumRSS on "big" (100+1=101) and
+	// "small" (1) before any pruning happens.
+	pruned := FilterTree(root, filter)
+
+	if len(pruned.Children) != 1 {
+		t.Fatalf("expected one child, got %d", len(pruned.Children))
+	}
+	bigClone := pruned.Children[0]
+	bigClone.Children = nil // simulate "small" having been pruned out
+
+	if got := bigClone.CalcAccumRSS(); got != bigClone.RSS {
+		t.Errorf("CalcAccumRSS() = %d, want %d (stale memoized total leaked through clone)",
+			got, bigClone.RSS)
+	}
+}
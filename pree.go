@@ -1,35 +1,112 @@
 package main
 
-import "path"
 import "sort"
 import "os"
-import "io/ioutil"
-import "bufio"
-import "strconv"
 import "fmt"
 import "strings"
-import "runtime"
 import "flag"
+import "time"
+import "encoding/json"
 
 type Options struct {
 	ShowRSS bool
 	ShowCPU bool
 	Reverse bool
 	SortFunc func(a *Process, b *Process) bool
+	MemMode string
+	GroupBy string
+	Interval time.Duration
+	ShowIO bool
+	ShowThreads bool
+	ShowSwap bool
+	ShowUser bool
+	Filter Filter
+}
+
+// NeedsSmaps reports whether the current options require parsing
+// /proc/[pid]/smaps, which is considerably more expensive than
+// /proc/[pid]/stat and so is only done on demand.
+func (opts *Options) NeedsSmaps() bool {
+	return opts.MemMode != "rss" || opts.GroupBy != "tree"
+}
+
+// NeedsIO reports whether /proc/[pid]/io needs parsing.
+func (opts *Options) NeedsIO() bool {
+	return opts.ShowIO
+}
+
+// NeedsStatus reports whether /proc/[pid]/status needs parsing. Threads,
+// VmSwap and Uid all live in the same file, so one flag being set is
+// enough to justify reading it.
+func (opts *Options) NeedsStatus() bool {
+	return opts.ShowThreads || opts.ShowSwap || opts.ShowUser
 }
 
 type Process struct {
 	Pid int
 	PPid int
 	RSS int
+	PSS int
+	USS int
 	CPU float32
 
+	Exe string
+	Cgroup string
+
+	// StartTime is the process's start time in clock ticks since boot, as
+	// reported by /proc/[pid]/stat. Together with Pid it identifies a
+	// process uniquely across ticks, so a PID getting reused by a new
+	// process isn't mistaken for the process we saw last tick.
+	StartTime int64
+	// Ticks and WallTicks are the (utime+stime) and TicksSinceBoot samples
+	// taken this tick; Prev* are the same samples from the previous tick,
+	// used to compute an instantaneous CPU% in -interval mode.
+	Ticks int64
+	WallTicks int64
+	PrevTicks int64
+	PrevWallTicks int64
+
+	// Threads, VmSwap and Uid/Username come from /proc/[pid]/status, and
+	// are only populated when -threads/-swap/-user ask for them.
+	Threads int
+	VmSwap int
+	Uid int
+	Username string
+
+	// ReadBytes/WriteBytes/RChar/WChar are cumulative counters from
+	// /proc/[pid]/io, only populated by -io. ReadRate/WriteRate are
+	// bytes/sec computed from the delta against the previous tick in
+	// -interval mode; Prev* hold that previous sample.
+	ReadBytes int64
+	WriteBytes int64
+	RChar int64
+	WChar int64
+	PrevReadBytes int64
+	PrevWriteBytes int64
+	ReadRate float64
+	WriteRate float64
+
 	AccumRSS int
+	AccumPSS int
+	AccumUSS int
 	AccumCPU float32
 	PrettyName string
 	Children []*Process
 }
 
+// MemValue returns the process's own memory usage for the given -mem mode
+// (rss/pss/uss).
+func (proc *Process) MemValue(mode string) int {
+	switch mode {
+	case "pss":
+		return proc.PSS
+	case "uss":
+		return proc.USS
+	default:
+		return proc.RSS
+	}
+}
+
 func (proc *Process) CalcAccumRSS() int {
 	if proc.AccumRSS > 0 {
 		return proc.AccumRSS
@@ -56,6 +133,45 @@ func (proc *Process) CalcAccumCPU() float32 {
 	return proc.AccumCPU
 }
 
+// CalcAccumMem is like CalcAccumRSS, but for the memory field selected by
+// the -mem flag.
+func (proc *Process) CalcAccumMem(mode string) int {
+	switch mode {
+	case "pss":
+		return proc.CalcAccumPSS()
+	case "uss":
+		return proc.CalcAccumUSS()
+	default:
+		return proc.CalcAccumRSS()
+	}
+}
+
+func (proc *Process) CalcAccumPSS() int {
+	if proc.AccumPSS > 0 {
+		return proc.AccumPSS
+	}
+
+	proc.AccumPSS = proc.PSS
+	for _, child := range proc.Children {
+		proc.AccumPSS += child.CalcAccumPSS()
+	}
+
+	return proc.AccumPSS
+}
+
+func (proc *Process) CalcAccumUSS() int {
+	if proc.AccumUSS > 0 {
+		return proc.AccumUSS
+	}
+
+	proc.AccumUSS = proc.USS
+	for _, child := range proc.Children {
+		proc.AccumUSS += child.CalcAccumUSS()
+	}
+
+	return proc.AccumUSS
+}
+
 type SortProcs struct {
 	Procs []*Process
 	Reverse bool
@@ -93,116 +209,326 @@ func PrettySize(kib int) string {
 	}
 }
 
-func ShowProcess(proc *Process, opts *Options) string {
-	if opts.ShowCPU && opts.ShowRSS {
-		return fmt.Sprintf("(#%d; %s %.01f%%) -- %s %.01f%%",
-			proc.Pid, PrettySize(proc.RSS), proc.CPU * 100,
-			PrettySize(proc.CalcAccumRSS()), proc.CalcAccumCPU() * 100)
-	} else if opts.ShowCPU {
-		return fmt.Sprintf("(#%d; %.01f%%) -- %.01f%%",
-			proc.Pid, proc.CPU * 100, proc.CalcAccumCPU() * 100)
-	} else if opts.ShowRSS {
-		return fmt.Sprintf("(#%d; %s -- %s",
-			proc.Pid, PrettySize(proc.RSS), PrettySize(proc.CalcAccumRSS()))
-	} else {
-		return fmt.Sprintf("(#%d)", proc.Pid)
+// ProcessView is the set of numeric fields pree reports for a process,
+// computed once per node and consumed by both the pretty-printers
+// (ShowProcess) and the JSON encoders (PrintJSONTree/PrintJSONFlat), so
+// they never disagree about what CalcAccumRSS/CalcAccumCPU returned.
+type ProcessView struct {
+	Pid int `json:"pid"`
+	PPid int `json:"ppid"`
+	PrettyName string `json:"name"`
+	RSS int `json:"rss"`
+	PSS int `json:"pss,omitempty"`
+	USS int `json:"uss,omitempty"`
+	CPU float32 `json:"cpu"`
+	AccumRSS int `json:"accum_rss"`
+	AccumPSS int `json:"accum_pss,omitempty"`
+	AccumUSS int `json:"accum_uss,omitempty"`
+	AccumCPU float32 `json:"accum_cpu"`
+	Threads int `json:"threads,omitempty"`
+	VmSwap int `json:"vm_swap,omitempty"`
+	Uid int `json:"uid,omitempty"`
+	Username string `json:"user,omitempty"`
+	ReadBytes int64 `json:"read_bytes,omitempty"`
+	WriteBytes int64 `json:"write_bytes,omitempty"`
+	RChar int64 `json:"rchar,omitempty"`
+	WChar int64 `json:"wchar,omitempty"`
+	ReadRate float64 `json:"read_bytes_per_sec,omitempty"`
+	WriteRate float64 `json:"write_bytes_per_sec,omitempty"`
+	Children []*ProcessView `json:"children,omitempty"`
+}
+
+// MemValue and AccumMemValue mirror Process.MemValue/CalcAccumMem, for
+// code that only has the already-computed view.
+func (view *ProcessView) MemValue(mode string) int {
+	switch mode {
+	case "pss":
+		return view.PSS
+	case "uss":
+		return view.USS
+	default:
+		return view.RSS
 	}
 }
 
-func TicksSinceBoot() (int64, error) {
-	file, err := os.Open("/proc/stat")
-	if err != nil { return 0, err }
-	defer file.Close()
-	r := bufio.NewReader(file)
+func (view *ProcessView) AccumMemValue(mode string) int {
+	switch mode {
+	case "pss":
+		return view.AccumPSS
+	case "uss":
+		return view.AccumUSS
+	default:
+		return view.AccumRSS
+	}
+}
 
-	line, err := r.ReadString('\n')
-	if err != nil { return 0, err }
+// BuildProcessFields computes proc's own ProcessView, without descending
+// into its children.
+func BuildProcessFields(proc *Process, opts *Options) *ProcessView {
+	view := &ProcessView{
+		Pid: proc.Pid,
+		PPid: proc.PPid,
+		PrettyName: proc.PrettyName,
+		RSS: proc.RSS,
+		CPU: proc.CPU,
+		AccumRSS: proc.CalcAccumRSS(),
+		AccumCPU: proc.CalcAccumCPU(),
+	}
 
-	fields := strings.Fields(line)
+	if opts.NeedsSmaps() {
+		view.PSS = proc.PSS
+		view.USS = proc.USS
+		view.AccumPSS = proc.CalcAccumPSS()
+		view.AccumUSS = proc.CalcAccumUSS()
+	}
 
-	var total int64 = 0
-	for _, val := range fields[1:] {
-		num, err := strconv.ParseInt(val, 10, 64)
-		if err != nil { return 0, err }
-		total += num
+	if opts.ShowThreads {
+		view.Threads = proc.Threads
+	}
+	if opts.ShowSwap {
+		view.VmSwap = proc.VmSwap
+	}
+	if opts.ShowUser {
+		view.Uid = proc.Uid
+		view.Username = proc.Username
+	}
+	if opts.ShowIO {
+		view.ReadBytes = proc.ReadBytes
+		view.WriteBytes = proc.WriteBytes
+		view.RChar = proc.RChar
+		view.WChar = proc.WChar
+		view.ReadRate = proc.ReadRate
+		view.WriteRate = proc.WriteRate
 	}
 
-	return total / int64(runtime.NumCPU()), nil
+	return view
 }
 
-func ReadProc(procs Processes, pid int) (*Process, error) {
-	if proc, ok := procs[pid]; ok {
-		return proc, nil
+// BuildProcessTree is BuildProcessFields, recursively applied to proc's
+// whole subtree, for the nested -style=json output.
+func BuildProcessTree(proc *Process, opts *Options) *ProcessView {
+	view := BuildProcessFields(proc, opts)
+	for _, child := range proc.Children {
+		view.Children = append(view.Children, BuildProcessTree(child, opts))
 	}
+	return view
+}
 
-	proc := &Process{Pid: pid}
+func ShowProcess(proc *Process, opts *Options) string {
+	view := BuildProcessFields(proc, opts)
+	mem := view.MemValue(opts.MemMode)
+	accumMem := view.AccumMemValue(opts.MemMode)
 
-	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
-	if err != nil { return nil, err }
+	var out string
+	if opts.ShowCPU && opts.ShowRSS {
+		out = fmt.Sprintf("(#%d; %s %.01f%%) -- %s %.01f%%",
+			view.Pid, PrettySize(mem), view.CPU * 100,
+			PrettySize(accumMem), view.AccumCPU * 100)
+	} else if opts.ShowCPU {
+		out = fmt.Sprintf("(#%d; %.01f%%) -- %.01f%%",
+			view.Pid, view.CPU * 100, view.AccumCPU * 100)
+	} else if opts.ShowRSS {
+		out = fmt.Sprintf("(#%d; %s -- %s",
+			view.Pid, PrettySize(mem), PrettySize(accumMem))
+	} else {
+		out = fmt.Sprintf("(#%d)", view.Pid)
+	}
 
-	statParts := strings.Split(string(stat), ") ")
-	statVals := strings.Split(statParts[1], " ")
+	if opts.ShowThreads {
+		out += fmt.Sprintf(" threads=%d", view.Threads)
+	}
+	if opts.ShowSwap {
+		out += fmt.Sprintf(" swap=%s", PrettySize(view.VmSwap))
+	}
+	if opts.ShowUser {
+		out += fmt.Sprintf(" user=%s", view.Username)
+	}
+	if opts.ShowIO {
+		// ReadBytes/WriteBytes for both halves of the pair, since
+		// ReadRate/WriteRate are deltas of those same counters - mixing in
+		// RChar/WChar (syscall read()/write() traffic, not actual
+		// block-device I/O) would pair a cumulative total against a rate
+		// derived from a different counter.
+		out += fmt.Sprintf(" io=r:%s/%s w:%s/%s",
+			PrettySize(int(view.ReadBytes / 1024)), PrettyRate(view.ReadRate),
+			PrettySize(int(view.WriteBytes / 1024)), PrettyRate(view.WriteRate))
+	}
 
-	name := strings.Split(statParts[0], " (")[1]
-	proc.PPid, err = strconv.Atoi(statVals[4-3])
-	if err != nil { return nil, err }
-	rssPages, err := strconv.Atoi(statVals[24-3])
-	if err != nil { return nil, err }
-	proc.RSS = (rssPages * os.Getpagesize()) / 1024;
+	return out
+}
 
-	uTime, err := strconv.ParseInt(statVals[14-3], 10, 64)
-	if err != nil { return nil, err }
-	sTime, err := strconv.ParseInt(statVals[15-3], 10, 64)
-	if err != nil { return nil, err }
-	startTime, err := strconv.ParseInt(statVals[22-3], 10, 64)
-	if err != nil { return nil, err }
+// PrettyRate formats a bytes/sec rate the same way PrettySize formats a
+// size, with a "/s" suffix. It's 0 (rather than any meaningful rate) until
+// -interval mode has seen two ticks to diff.
+func PrettyRate(bytesPerSec float64) string {
+	return PrettySize(int(bytesPerSec / 1024)) + "/s"
+}
 
-	// Do this for every process, right after reading /proc/[pid]/stat,
-	// for best accuracy
-	totalTime, err := TicksSinceBoot()
-	if err != nil { return nil, err }
+// flatProcessView is a ProcessView plus the tree position fields
+// -style=json-flat adds to every line, since a flat stream can't encode
+// parent/child relationships through nesting.
+type flatProcessView struct {
+	ProcessView
+	Depth int `json:"depth"`
+	ParentPid int `json:"parent_pid"`
+}
 
-	proc.CPU = float32(uTime + sTime) / (float32(totalTime) - float32(startTime))
+// PrintJSONTree prints proc's whole subtree as a single JSON document, for
+// -style=json.
+func PrintJSONTree(proc *Process, opts *Options) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(BuildProcessTree(proc, opts))
+}
 
-	realPath, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
-	if err != nil {
-		proc.PrettyName = name
-	} else {
-		proc.PrettyName = path.Base(realPath)
+// PrintJSONFlat prints one JSON object per line (ndjson), for
+// -style=json-flat.
+func PrintJSONFlat(proc *Process, opts *Options) error {
+	return printJSONFlat(proc, opts, 0, proc.PPid, json.NewEncoder(os.Stdout))
+}
+
+func printJSONFlat(proc *Process, opts *Options, depth int, parentPid int, enc *json.Encoder) error {
+	flat := flatProcessView{
+		ProcessView: *BuildProcessFields(proc, opts),
+		Depth: depth,
+		ParentPid: parentPid,
+	}
+	if err := enc.Encode(flat); err != nil {
+		return err
 	}
 
-	var parent *Process
-	if proc.PPid != 0 {
-		var ok bool
-		parent, ok = procs[proc.PPid]
+	for _, child := range proc.Children {
+		if err := printJSONFlat(child, opts, depth + 1, proc.Pid, enc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MemGroup is a bucket of processes sharing the same exe target or cgroup
+// path, as printed by -group-by.
+type MemGroup struct {
+	Key string
+	RSS int
+	PSS int
+	USS int
+	Count int
+}
+
+// GroupKey returns the bucket a process belongs to under the given
+// -group-by mode.
+func GroupKey(proc *Process, groupBy string) string {
+	switch groupBy {
+	case "exe":
+		if proc.Exe != "" { return proc.Exe }
+		return proc.PrettyName
+	case "cgroup":
+		if proc.Cgroup != "" { return proc.Cgroup }
+		return "?"
+	default:
+		return proc.PrettyName
+	}
+}
+
+// GroupProcesses buckets every process in procs by GroupKey, summing their
+// memory usage per bucket.
+func GroupProcesses(procs Processes, groupBy string) []*MemGroup {
+	groups := map[string]*MemGroup{}
+	for _, proc := range procs {
+		key := GroupKey(proc, groupBy)
+		group, ok := groups[key]
 		if !ok {
-			parent, err = ReadProc(procs, proc.PPid)
-			if err != nil {
-				return nil, err
-			}
+			group = &MemGroup{Key: key}
+			groups[key] = group
 		}
 
-		parent.Children = append(parent.Children, proc)
+		group.RSS += proc.RSS
+		group.PSS += proc.PSS
+		group.USS += proc.USS
+		group.Count++
+	}
+
+	list := make([]*MemGroup, 0, len(groups))
+	for _, group := range groups {
+		list = append(list, group)
 	}
 
-	procs[pid] = proc
-	return proc, nil
+	return list
 }
 
-func ReadProcs(procs Processes) {
-	files, err := ioutil.ReadDir("/proc")
-	if err != nil { panic(err) }
+// PrintGroupTable prints a sorted table of total memory usage per bucket,
+// used by -group-by=exe and -group-by=cgroup instead of the process tree.
+func PrintGroupTable(procs Processes, opts *Options) {
+	groups := GroupProcesses(procs, opts.GroupBy)
+
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		var less bool
+		switch opts.MemMode {
+		case "pss":
+			less = a.PSS < b.PSS
+		case "uss":
+			less = a.USS < b.USS
+		default:
+			less = a.RSS < b.RSS
+		}
+		if opts.Reverse {
+			return less
+		}
+		return !less
+	})
 
-	for _, file := range files {
-		if (!file.IsDir()) { continue; }
-		pid, err := strconv.ParseInt(file.Name(), 10, 32)
-		if err != nil { continue; }
+	fmt.Printf("%-40s %6s %10s %10s %10s\n", "NAME", "PROCS", "RSS", "PSS", "USS")
+	for _, group := range groups {
+		fmt.Printf("%-40s %6d %10s %10s %10s\n",
+			group.Key, group.Count,
+			PrettySize(group.RSS), PrettySize(group.PSS), PrettySize(group.USS))
+	}
+}
 
-		_, err = ReadProc(procs, int(pid))
-		if err != nil {
-			fmt.Println(err)
+// filterChildren filters proc's children against filter, applying the
+// promotion rule: a child matching filter is kept (with its own children
+// filtered the same way), while a child that doesn't match is dropped but
+// its matching descendants are spliced into proc's children in its place,
+// so a filter like `name~nginx` still shows the worker-under-master
+// structure even across an intermediate process that doesn't match.
+func filterChildren(proc *Process, filter Filter) []*Process {
+	var out []*Process
+	for _, child := range proc.Children {
+		if filter.Eval(child) {
+			clone := *child
+			// Eval may have memoized CalcAccumRSS/CalcAccumCPU on the
+			// original child (e.g. a filter referencing accum_rss/accum_cpu
+			// evaluates every node), caching totals over its unpruned
+			// subtree. Clear them so the clone's CalcAccum* recompute over
+			// its pruned/promoted Children below.
+			clone.AccumRSS = 0
+			clone.AccumPSS = 0
+			clone.AccumUSS = 0
+			clone.AccumCPU = 0
+			clone.Children = filterChildren(child, filter)
+			out = append(out, &clone)
+		} else {
+			out = append(out, filterChildren(child, filter)...)
 		}
 	}
+	return out
+}
+
+// FilterTree returns a pruned copy of the tree rooted at proc for the
+// given -filter expression, promoting descendants of a non-matching
+// process up to their nearest matching ancestor. proc itself is always
+// kept, since it's the tree's requested root rather than a candidate for
+// pruning. Returns proc unchanged if filter is nil.
+func FilterTree(proc *Process, filter Filter) *Process {
+	if filter == nil {
+		return proc
+	}
+
+	clone := *proc
+	clone.Children = filterChildren(proc, filter)
+	return &clone
 }
 
 func PrintFancyTree(proc *Process, opts *Options, prefix string, bar string, connector string) {
@@ -267,35 +593,133 @@ func PrintBoringRoot(proc *Process, opts *Options) {
 func main() {
 	showRSSFlag := flag.Bool("rss", true, "Show RSS")
 	showCPUFlag := flag.Bool("cpu", true, "Show CPU")
-	sortFlag := flag.String("sort", "rss", "Field to sort by (rss/cpu)")
+	sortFlag := flag.String("sort", "rss", "Field to sort by (rss|cpu|io|threads|swap)")
 	reverseFlag := flag.Bool("reverse", false, "Reverse sort direction")
 	rootPidFlag := flag.Int("root", 1, "The PID to treat as the root of the process tree")
-	styleFlag := flag.String("style", "auto", "Style (fancy|boring|auto)")
+	styleFlag := flag.String("style", "auto", "Style (fancy|boring|auto|json|json-flat)")
+	memFlag := flag.String("mem", "rss", "Memory field to show/sort by (rss|pss|uss)")
+	groupByFlag := flag.String("group-by", "tree", "How to aggregate processes (tree|exe|cgroup)")
+	intervalFlag := flag.Duration("interval", 0, "Refresh continuously at this interval, like top (e.g. -interval=2s)")
+	ioFlag := flag.Bool("io", false, "Show per-process I/O from /proc/[pid]/io")
+	threadsFlag := flag.Bool("threads", false, "Show thread count from /proc/[pid]/status")
+	swapFlag := flag.Bool("swap", false, "Show swapped memory from /proc/[pid]/status")
+	userFlag := flag.Bool("user", false, "Show owning user from /proc/[pid]/status")
+	filterFlag := flag.String("filter", "", `Filter expression, e.g. rss>100M && name~"^java"`)
 	flag.Parse()
 
 	var opts Options
 	opts.ShowRSS = *showRSSFlag
 	opts.ShowCPU = *showCPUFlag
 	opts.Reverse = *reverseFlag
-	if *sortFlag == "rss" {
+	opts.ShowIO = *ioFlag
+	opts.ShowThreads = *threadsFlag
+	opts.ShowSwap = *swapFlag
+	opts.ShowUser = *userFlag
+
+	if *filterFlag != "" {
+		filter, err := ParseFilter(*filterFlag)
+		if err != nil {
+			fmt.Printf("Invalid filter: %s\n", err)
+			os.Exit(1)
+		}
+		opts.Filter = filter
+	}
+
+	switch *memFlag {
+	case "rss", "pss", "uss":
+		opts.MemMode = *memFlag
+	default:
+		fmt.Printf("Unknown mem option: %s\n", *memFlag)
+		os.Exit(1)
+	}
+
+	switch *groupByFlag {
+	case "tree", "exe", "cgroup":
+		opts.GroupBy = *groupByFlag
+	default:
+		fmt.Printf("Unknown group-by option: %s\n", *groupByFlag)
+		os.Exit(1)
+	}
+
+	switch *sortFlag {
+	case "rss":
 		opts.SortFunc = func(a *Process, b *Process) bool {
-			return a.CalcAccumRSS() < b.CalcAccumRSS()
+			return a.CalcAccumMem(opts.MemMode) < b.CalcAccumMem(opts.MemMode)
 		}
-	} else if *sortFlag == "cpu" {
+	case "cpu":
 		opts.SortFunc = func(a *Process, b *Process) bool {
 			return a.CalcAccumCPU() < b.CalcAccumCPU()
 		}
-	} else {
+	case "io":
+		opts.SortFunc = func(a *Process, b *Process) bool {
+			return a.ReadBytes + a.WriteBytes < b.ReadBytes + b.WriteBytes
+		}
+	case "threads":
+		opts.SortFunc = func(a *Process, b *Process) bool {
+			return a.Threads < b.Threads
+		}
+	case "swap":
+		opts.SortFunc = func(a *Process, b *Process) bool {
+			return a.VmSwap < b.VmSwap
+		}
+	default:
 		fmt.Printf("Unknown sort option: %s\n", *sortFlag)
 		os.Exit(1)
 	}
 
+	opts.Interval = *intervalFlag
+
 	procs := Processes{}
-	ReadProcs(procs)
-	rootProc, ok := procs[*rootPidFlag]
+	ReadProcs(procs, &opts)
+	PrintSnapshot(procs, &opts, *rootPidFlag, *styleFlag)
+
+	for opts.Interval > 0 {
+		time.Sleep(opts.Interval)
+		ReadProcs(procs, &opts)
+		ClearScreen()
+		PrintSnapshot(procs, &opts, *rootPidFlag, *styleFlag)
+	}
+}
+
+// ClearScreen resets the cursor to the top left and clears the terminal,
+// the same trick top/htop use to redraw in place each tick.
+func ClearScreen() {
+	fmt.Print("\x1b[H\x1b[2J")
+}
+
+// PrintSnapshot prints procs once, either as a grouped table or as the
+// process tree rooted at rootPid, depending on opts.GroupBy/style.
+func PrintSnapshot(procs Processes, opts *Options, rootPid int, style string) {
+	if opts.GroupBy != "tree" {
+		PrintGroupTable(procs, opts)
+		return
+	}
+
+	rootProc, ok := procs[rootPid]
 	if !ok {
-		fmt.Printf("No PID %d!\n", *rootPidFlag)
-		os.Exit(1)
+		fmt.Printf("No PID %d!\n", rootPid)
+		if opts.Interval == 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Applied once here, rather than in each style's printer, so -filter
+	// affects -style=json/json-flat the same way it does the tree styles.
+	rootProc = FilterTree(rootProc, opts.Filter)
+
+	if style == "json" {
+		if err := PrintJSONTree(rootProc, opts); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	} else if style == "json-flat" {
+		if err := PrintJSONFlat(rootProc, opts); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
 	}
 
 	ttyStat, err := os.Stdout.Stat()
@@ -304,12 +728,12 @@ func main() {
 		isTTY = (ttyStat.Mode() & os.ModeCharDevice) != 0
 	}
 
-	if *styleFlag == "fancy" || (*styleFlag == "auto" && isTTY) {
-		PrintFancyRoot(rootProc, &opts)
-	} else if *styleFlag == "boring" || (*styleFlag == "auto" && !isTTY) {
-		PrintBoringRoot(rootProc, &opts)
+	if style == "fancy" || (style == "auto" && isTTY) {
+		PrintFancyRoot(rootProc, opts)
+	} else if style == "boring" || (style == "auto" && !isTTY) {
+		PrintBoringRoot(rootProc, opts)
 	} else {
-		fmt.Printf("Unknown style option: %s\n", *styleFlag)
+		fmt.Printf("Unknown style option: %s\n", style)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,138 @@
+package main
+
+import "fmt"
+
+// ProcessSource abstracts how pree discovers and reads processes, so the
+// same tree/table printing code runs unmodified on every OS. Each
+// supported OS provides one in a process_<os>.go file selected by a
+// //go:build tag, following the pattern gopsutil uses for its per-OS
+// process_*.go files.
+type ProcessSource interface {
+	// ListPIDs returns every process ID currently running.
+	ListPIDs() []int
+
+	// ReadProcess reads a single process's stats into a fresh *Process.
+	// The tree-only fields (Children) and the per-tick accumulators are
+	// left zero; ReadProc fills those in.
+	ReadProcess(pid int, opts *Options) (*Process, error)
+
+	// ClockInfo returns the OS's scheduler tick rate and the number of
+	// ticks elapsed since boot, used to turn a process's cumulative CPU
+	// ticks into a CPU% of wall-clock time.
+	ClockInfo() (ticksPerSec int, uptimeTicks int64, err error)
+}
+
+// source is the ProcessSource for the current OS, set by that OS's
+// process_<os>.go file from an init().
+var source ProcessSource
+
+// ReadProc reads process pid into procs[pid] via the current ProcessSource,
+// attaching it to its parent's Children. seen tracks which PIDs have
+// already been (re)read this pass, both to avoid redundant work when the
+// PID walk reaches a process whose parent was already pulled in by an
+// earlier child, and so ReadProcs can prune PIDs that vanished since the
+// last call.
+//
+// If procs already holds a *Process for pid with a matching StartTime, it's
+// updated in place (so -interval mode can compute a CPU delta against the
+// previous tick's sample) rather than replaced; a different StartTime means
+// the PID was reused by an unrelated process, so it's treated as new.
+func ReadProc(procs Processes, seen map[int]bool, pid int, opts *Options) (*Process, error) {
+	if seen[pid] {
+		return procs[pid], nil
+	}
+
+	read, err := source.ReadProcess(pid, opts)
+	if err != nil { return nil, err }
+
+	ticksPerSec, uptimeTicks, err := source.ClockInfo()
+	if err != nil { return nil, err }
+
+	proc, existed := procs[pid]
+	if existed && proc.StartTime == read.StartTime {
+		// Same process we saw last tick: remember its previous CPU/IO
+		// samples for the deltas below, and reset the accumulators so
+		// CalcAccumRSS/CalcAccumCPU recompute instead of returning last
+		// tick's cached total.
+		proc.PrevTicks = proc.Ticks
+		proc.PrevWallTicks = proc.WallTicks
+		proc.PrevReadBytes = proc.ReadBytes
+		proc.PrevWriteBytes = proc.WriteBytes
+		proc.AccumRSS = 0
+		proc.AccumPSS = 0
+		proc.AccumUSS = 0
+		proc.AccumCPU = 0
+		proc.Children = proc.Children[:0]
+	} else {
+		proc = &Process{Pid: pid, StartTime: read.StartTime}
+	}
+
+	seen[pid] = true
+	procs[pid] = proc
+
+	proc.PPid = read.PPid
+	proc.RSS = read.RSS
+	proc.PSS = read.PSS
+	proc.USS = read.USS
+	proc.Exe = read.Exe
+	proc.Cgroup = read.Cgroup
+	proc.PrettyName = read.PrettyName
+	proc.Ticks = read.Ticks
+	proc.WallTicks = uptimeTicks
+	proc.Threads = read.Threads
+	proc.VmSwap = read.VmSwap
+	proc.Uid = read.Uid
+	proc.Username = read.Username
+	proc.ReadBytes = read.ReadBytes
+	proc.WriteBytes = read.WriteBytes
+	proc.RChar = read.RChar
+	proc.WChar = read.WChar
+
+	if proc.PrevWallTicks > 0 && proc.WallTicks > proc.PrevWallTicks {
+		proc.CPU = float32(proc.Ticks - proc.PrevTicks) / float32(proc.WallTicks - proc.PrevWallTicks)
+
+		elapsedSecs := float64(proc.WallTicks - proc.PrevWallTicks) / float64(ticksPerSec)
+		proc.ReadRate = float64(proc.ReadBytes - proc.PrevReadBytes) / elapsedSecs
+		proc.WriteRate = float64(proc.WriteBytes - proc.PrevWriteBytes) / elapsedSecs
+	} else {
+		// Subtract in int64 before converting to float32: WallTicks and
+		// StartTime individually can be far too large for float32 to
+		// represent exactly (Unix seconds on darwin, 100ns units on
+		// windows), so converting each separately first loses enough
+		// precision to swing the result to 0 or worse.
+		proc.CPU = float32(proc.Ticks) / float32(proc.WallTicks-proc.StartTime)
+	}
+
+	if proc.PPid != 0 {
+		parent, err := ReadProc(procs, seen, proc.PPid, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		parent.Children = append(parent.Children, proc)
+	}
+
+	return proc, nil
+}
+
+// ReadProcs (re)populates procs from the current ProcessSource. Calling it
+// again on a map it previously populated refreshes every process in place
+// (see ReadProc) and prunes PIDs that have since exited, which is what
+// -interval mode does on each tick.
+func ReadProcs(procs Processes, opts *Options) {
+	pids := source.ListPIDs()
+
+	seen := map[int]bool{}
+	for _, pid := range pids {
+		_, err := ReadProc(procs, seen, pid, opts)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	for pid := range procs {
+		if !seen[pid] {
+			delete(procs, pid)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+//go:build linux
+
+package main
+
+import "bufio"
+import "fmt"
+import "io/ioutil"
+import "os"
+import "os/user"
+import "path"
+import "runtime"
+import "strconv"
+import "strings"
+
+func init() {
+	source = linuxProcSource{}
+}
+
+// linuxProcSource is the ProcessSource backed by /proc, i.e. pree's
+// original (and still primary) way of reading processes.
+type linuxProcSource struct{}
+
+// pageSizeKiB is the system page size in KiB, computed once since
+// os.Getpagesize() never changes for the lifetime of the process.
+var pageSizeKiB = os.Getpagesize() / 1024
+
+// linuxClockTicksPerSec is USER_HZ, the kernel's scheduling clock tick
+// rate baked into /proc/[pid]/stat on essentially every Linux system.
+const linuxClockTicksPerSec = 100
+
+func (linuxProcSource) ListPIDs() []int {
+	files, err := ioutil.ReadDir("/proc")
+	if err != nil { panic(err) }
+
+	pids := make([]int, 0, len(files))
+	for _, file := range files {
+		if !file.IsDir() { continue }
+		pid, err := strconv.Atoi(file.Name())
+		if err != nil { continue }
+		pids = append(pids, pid)
+	}
+
+	return pids
+}
+
+func (linuxProcSource) ReadProcess(pid int, opts *Options) (*Process, error) {
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil { return nil, err }
+
+	statParts := strings.Split(string(stat), ") ")
+	statVals := strings.Split(statParts[1], " ")
+	name := strings.Split(statParts[0], " (")[1]
+
+	proc := &Process{Pid: pid}
+
+	proc.PPid, err = strconv.Atoi(statVals[4-3])
+	if err != nil { return nil, err }
+	rssPages, err := strconv.Atoi(statVals[24-3])
+	if err != nil { return nil, err }
+	proc.RSS = rssPages * pageSizeKiB
+
+	uTime, err := strconv.ParseInt(statVals[14-3], 10, 64)
+	if err != nil { return nil, err }
+	sTime, err := strconv.ParseInt(statVals[15-3], 10, 64)
+	if err != nil { return nil, err }
+	proc.Ticks = uTime + sTime
+
+	proc.StartTime, err = strconv.ParseInt(statVals[22-3], 10, 64)
+	if err != nil { return nil, err }
+
+	realPath, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		proc.PrettyName = name
+	} else {
+		proc.Exe = realPath
+		proc.PrettyName = path.Base(realPath)
+	}
+
+	if opts.NeedsSmaps() {
+		pss, uss, err := readSmaps(pid)
+		if err != nil {
+			// /proc/[pid]/smaps is often unreadable for processes we
+			// don't own; fall back to RSS rather than aborting.
+			proc.PSS = proc.RSS
+			proc.USS = proc.RSS
+		} else {
+			proc.PSS = pss
+			proc.USS = uss
+		}
+	}
+
+	if opts.GroupBy == "cgroup" {
+		proc.Cgroup, _ = readCgroup(pid)
+	}
+
+	if opts.NeedsIO() {
+		readBytes, writeBytes, rchar, wchar, err := readIO(pid)
+		if err == nil {
+			// /proc/[pid]/io is often root-only for processes we don't
+			// own; leave the counters at zero rather than aborting.
+			proc.ReadBytes = readBytes
+			proc.WriteBytes = writeBytes
+			proc.RChar = rchar
+			proc.WChar = wchar
+		}
+	}
+
+	if opts.NeedsStatus() {
+		threads, vmSwap, uid, err := readStatus(pid)
+		if err == nil {
+			proc.Threads = threads
+			proc.VmSwap = vmSwap
+			proc.Uid = uid
+			if opts.ShowUser {
+				proc.Username = lookupUsername(uid)
+			}
+		}
+	}
+
+	return proc, nil
+}
+
+func (linuxProcSource) ClockInfo() (int, int64, error) {
+	file, err := os.Open("/proc/stat")
+	if err != nil { return 0, 0, err }
+	defer file.Close()
+	r := bufio.NewReader(file)
+
+	line, err := r.ReadString('\n')
+	if err != nil { return 0, 0, err }
+
+	fields := strings.Fields(line)
+
+	var total int64 = 0
+	for _, val := range fields[1:] {
+		num, err := strconv.ParseInt(val, 10, 64)
+		if err != nil { return 0, 0, err }
+		total += num
+	}
+
+	// /proc/stat's cpu line sums ticks across every core, so dividing by
+	// NumCPU recovers wall-clock ticks elapsed since boot.
+	return linuxClockTicksPerSec, total / int64(runtime.NumCPU()), nil
+}
+
+// readSmaps parses /proc/[pid]/smaps and returns the process's PSS
+// (proportional set size) and USS (unique set size, i.e. private memory)
+// in KiB. PSS attributes shared pages proportionally to every process
+// mapping them, so summing it across a set of processes doesn't
+// double-count shared libraries the way RSS does.
+func readSmaps(pid int) (pss int, uss int, err error) {
+	file, err := os.Open(fmt.Sprintf("/proc/%d/smaps", pid))
+	if err != nil { return 0, 0, err }
+	defer file.Close()
+
+	r := bufio.NewScanner(file)
+	for r.Scan() {
+		line := r.Text()
+		if strings.HasPrefix(line, "Pss:") {
+			pss += smapsFieldKiB(line)
+		} else if strings.HasPrefix(line, "Private_Clean:") || strings.HasPrefix(line, "Private_Dirty:") {
+			uss += smapsFieldKiB(line)
+		}
+	}
+
+	return pss, uss, r.Err()
+}
+
+// smapsFieldKiB extracts the KiB value from a smaps line of the form
+// "Pss:                 12 kB".
+func smapsFieldKiB(line string) int {
+	fields := strings.Fields(line)
+	if len(fields) < 2 { return 0 }
+	val, err := strconv.Atoi(fields[1])
+	if err != nil { return 0 }
+	return val
+}
+
+// readCgroup returns the cgroup path for pid, as reported by
+// /proc/[pid]/cgroup. On cgroup v2 systems there's a single "0::" line; on
+// v1 systems we fall back to the first line, which is usually as
+// meaningful a grouping as any single controller.
+func readCgroup(pid int) (string, error) {
+	file, err := os.Open(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil { return "", err }
+	defer file.Close()
+
+	r := bufio.NewScanner(file)
+	first := ""
+	for r.Scan() {
+		line := r.Text()
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 { continue }
+		if first == "" { first = parts[2] }
+		if parts[0] == "0" { return parts[2], nil }
+	}
+
+	return first, r.Err()
+}
+
+// readIO parses /proc/[pid]/io and returns its read_bytes, write_bytes,
+// rchar and wchar counters in bytes.
+func readIO(pid int) (readBytes int64, writeBytes int64, rchar int64, wchar int64, err error) {
+	file, err := os.Open(fmt.Sprintf("/proc/%d/io", pid))
+	if err != nil { return 0, 0, 0, 0, err }
+	defer file.Close()
+
+	r := bufio.NewScanner(file)
+	for r.Scan() {
+		line := r.Text()
+		switch {
+		case strings.HasPrefix(line, "read_bytes:"):
+			readBytes = ioFieldBytes(line)
+		case strings.HasPrefix(line, "write_bytes:"):
+			writeBytes = ioFieldBytes(line)
+		case strings.HasPrefix(line, "rchar:"):
+			rchar = ioFieldBytes(line)
+		case strings.HasPrefix(line, "wchar:"):
+			wchar = ioFieldBytes(line)
+		}
+	}
+
+	return readBytes, writeBytes, rchar, wchar, r.Err()
+}
+
+// ioFieldBytes extracts the byte count from a /proc/[pid]/io line of the
+// form "read_bytes: 12345".
+func ioFieldBytes(line string) int64 {
+	fields := strings.Fields(line)
+	if len(fields) < 2 { return 0 }
+	val, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil { return 0 }
+	return val
+}
+
+// readStatus parses /proc/[pid]/status and returns the Threads, VmSwap
+// (KiB) and Uid fields.
+func readStatus(pid int) (threads int, vmSwapKiB int, uid int, err error) {
+	file, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil { return 0, 0, 0, err }
+	defer file.Close()
+
+	r := bufio.NewScanner(file)
+	for r.Scan() {
+		line := r.Text()
+		fields := strings.Fields(line)
+		if len(fields) < 2 { continue }
+
+		switch fields[0] {
+		case "Threads:":
+			threads, _ = strconv.Atoi(fields[1])
+		case "VmSwap:":
+			vmSwapKiB, _ = strconv.Atoi(fields[1])
+		case "Uid:":
+			uid, _ = strconv.Atoi(fields[1])
+		}
+	}
+
+	return threads, vmSwapKiB, uid, r.Err()
+}
+
+// lookupUsername resolves uid to a username, falling back to the numeric
+// uid if it's not in the local user database (e.g. a container with no
+// /etc/passwd entry for it).
+func lookupUsername(uid int) string {
+	u, err := user.LookupId(strconv.Itoa(uid))
+	if err != nil { return strconv.Itoa(uid) }
+	return u.Username
+}